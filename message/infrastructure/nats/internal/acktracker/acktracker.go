@@ -0,0 +1,163 @@
+// Package acktracker provides the async ack-tracking loop shared by the stan-based
+// and JetStream-based NATS subscribers.
+package acktracker
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// Pending is a message handed off to the consumer but not yet Acked, Nacked or
+// timed out.
+type Pending struct {
+	// UUID identifies the message and must be unique among messages tracked at
+	// the same time.
+	UUID string
+
+	Acked   <-chan struct{}
+	Nacked  <-chan struct{}
+	Timeout <-chan time.Time
+
+	LogFields watermill.LogFields
+	Cancel    context.CancelFunc
+	Done      func()
+
+	// Ack sends the broker-level ack. Required.
+	Ack func() error
+
+	// Nack sends the broker-level nack. Optional: some brokers (e.g. NATS
+	// Streaming) have no nack of their own, in which case it is left nil and
+	// only the Watermill-level Nack is observed.
+	Nack func() error
+}
+
+// Tracker lets a subscriber hand a message off to the broker and return
+// immediately, instead of blocking its delivery goroutine (or, for batch/pull
+// consumers, the whole batch) on that one message's Ack/Nack/timeout. This is
+// what makes a broker-side in-flight limit (e.g. stan.MaxInflight) meaningful:
+// the broker can keep delivering new messages while previously delivered ones
+// are still pending.
+//
+// A single goroutine per subscription, started by Run, waits on every pending
+// message's Acked/Nacked/timeout channel at once via reflect.Select.
+type Tracker struct {
+	logger watermill.LoggerAdapter
+
+	pending map[string]*Pending
+	add     chan *Pending
+}
+
+// New creates a new Tracker. Run must be started in its own goroutine for
+// tracked messages to ever be resolved.
+func New(logger watermill.LoggerAdapter) *Tracker {
+	return &Tracker{
+		logger:  logger,
+		pending: make(map[string]*Pending),
+		add:     make(chan *Pending),
+	}
+}
+
+// Track registers pm as pending. It blocks until Run's loop has picked it up, but
+// does not wait for pm to be Acked/Nacked/timed out.
+func (t *Tracker) Track(pm *Pending, stopped <-chan struct{}) {
+	select {
+	case t.add <- pm:
+	case <-stopped:
+		pm.Cancel()
+		pm.Done()
+	}
+}
+
+// Run waits on every pending message's Acked/Nacked/timeout channel, as well as
+// on newly tracked messages, until stopped is closed.
+func (t *Tracker) Run(stopped <-chan struct{}) {
+	const (
+		caseStopped = iota
+		caseAdd
+		caseFirstPending
+	)
+
+	for {
+		type waiter struct {
+			uuid string
+			pm   *Pending
+			kind string // "ack", "nack" or "timeout"
+		}
+
+		var waiters []waiter
+		for uuid, pm := range t.pending {
+			waiters = append(waiters, waiter{uuid, pm, "ack"})
+			waiters = append(waiters, waiter{uuid, pm, "nack"})
+			waiters = append(waiters, waiter{uuid, pm, "timeout"})
+		}
+
+		cases := make([]reflect.SelectCase, 0, caseFirstPending+len(waiters))
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stopped)},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(t.add)},
+		)
+		for _, w := range waiters {
+			var ch interface{}
+			switch w.kind {
+			case "ack":
+				ch = w.pm.Acked
+			case "nack":
+				ch = w.pm.Nacked
+			case "timeout":
+				ch = w.pm.Timeout
+			}
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+		}
+
+		chosen, recv, _ := reflect.Select(cases)
+
+		switch chosen {
+		case caseStopped:
+			t.Drain()
+			return
+		case caseAdd:
+			pm := recv.Interface().(*Pending)
+			t.pending[pm.UUID] = pm
+		default:
+			w := waiters[chosen-caseFirstPending]
+			delete(t.pending, w.uuid)
+			t.resolve(w.pm, w.kind)
+		}
+	}
+}
+
+// Drain cancels and releases every message still pending, so none of them are
+// left dangling when the tracker is stopped before they were Acked/Nacked/timed
+// out.
+func (t *Tracker) Drain() {
+	for uuid, pm := range t.pending {
+		delete(t.pending, uuid)
+		pm.Cancel()
+		pm.Done()
+	}
+}
+
+func (t *Tracker) resolve(pm *Pending, kind string) {
+	defer pm.Cancel()
+	defer pm.Done()
+
+	switch kind {
+	case "ack":
+		if err := pm.Ack(); err != nil {
+			t.logger.Error("Cannot send ack", err, pm.LogFields)
+		}
+		t.logger.Trace("Message Acked", pm.LogFields)
+	case "nack":
+		if pm.Nack != nil {
+			if err := pm.Nack(); err != nil {
+				t.logger.Error("Cannot send nack", err, pm.LogFields)
+			}
+		}
+		t.logger.Trace("Message Nacked", pm.LogFields)
+	case "timeout":
+		t.logger.Trace("Ack timeouted", pm.LogFields)
+	}
+}
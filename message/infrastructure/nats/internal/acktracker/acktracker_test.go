@@ -0,0 +1,151 @@
+package acktracker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+func TestTracker_ack(t *testing.T) {
+	tracker := New(watermill.NopLogger{})
+	stopped := make(chan struct{})
+	go tracker.Run(stopped)
+	defer close(stopped)
+
+	acked := make(chan struct{})
+	close(acked)
+
+	ackCalled := make(chan struct{})
+	done := make(chan struct{})
+
+	tracker.Track(&Pending{
+		UUID:    "1",
+		Acked:   acked,
+		Nacked:  make(chan struct{}),
+		Timeout: make(chan time.Time),
+		Cancel:  func() {},
+		Done:    func() { close(done) },
+		Ack:     func() error { close(ackCalled); return nil },
+		Nack:    func() error { t.Fatal("Nack should not be called"); return nil },
+	}, stopped)
+
+	waitClosed(t, ackCalled, "Ack was not called")
+	waitClosed(t, done, "Done was not called")
+}
+
+func TestTracker_nack(t *testing.T) {
+	tracker := New(watermill.NopLogger{})
+	stopped := make(chan struct{})
+	go tracker.Run(stopped)
+	defer close(stopped)
+
+	nacked := make(chan struct{})
+	close(nacked)
+
+	nackCalled := make(chan struct{})
+	done := make(chan struct{})
+
+	tracker.Track(&Pending{
+		UUID:    "1",
+		Acked:   make(chan struct{}),
+		Nacked:  nacked,
+		Timeout: make(chan time.Time),
+		Cancel:  func() {},
+		Done:    func() { close(done) },
+		Ack:     func() error { t.Fatal("Ack should not be called"); return nil },
+		Nack:    func() error { close(nackCalled); return nil },
+	}, stopped)
+
+	waitClosed(t, nackCalled, "Nack was not called")
+	waitClosed(t, done, "Done was not called")
+}
+
+// TestTracker_nack_nilCallback exercises the stan use case, which has no nack of its
+// own and leaves Pending.Nack nil.
+func TestTracker_nack_nilCallback(t *testing.T) {
+	tracker := New(watermill.NopLogger{})
+	stopped := make(chan struct{})
+	go tracker.Run(stopped)
+	defer close(stopped)
+
+	nacked := make(chan struct{})
+	close(nacked)
+
+	done := make(chan struct{})
+
+	tracker.Track(&Pending{
+		UUID:    "1",
+		Acked:   make(chan struct{}),
+		Nacked:  nacked,
+		Timeout: make(chan time.Time),
+		Cancel:  func() {},
+		Done:    func() { close(done) },
+		Ack:     func() error { t.Fatal("Ack should not be called"); return nil },
+	}, stopped)
+
+	waitClosed(t, done, "Done was not called")
+}
+
+func TestTracker_timeout(t *testing.T) {
+	tracker := New(watermill.NopLogger{})
+	stopped := make(chan struct{})
+	go tracker.Run(stopped)
+	defer close(stopped)
+
+	timeout := make(chan time.Time, 1)
+	timeout <- time.Now()
+
+	cancelled := make(chan struct{})
+	done := make(chan struct{})
+
+	tracker.Track(&Pending{
+		UUID:    "1",
+		Acked:   make(chan struct{}),
+		Nacked:  make(chan struct{}),
+		Timeout: timeout,
+		Cancel:  func() { close(cancelled) },
+		Done:    func() { close(done) },
+		Ack:     func() error { t.Fatal("Ack should not be called on timeout"); return nil },
+	}, stopped)
+
+	waitClosed(t, cancelled, "Cancel was not called")
+	waitClosed(t, done, "Done was not called")
+}
+
+// TestTracker_drain exercises stopping the tracker before a pending message was ever
+// Acked/Nacked/timed out: it must still be cancelled and released rather than left
+// dangling.
+func TestTracker_drain(t *testing.T) {
+	tracker := New(watermill.NopLogger{})
+	stopped := make(chan struct{})
+	go tracker.Run(stopped)
+
+	cancelled := make(chan struct{})
+	done := make(chan struct{})
+
+	tracker.Track(&Pending{
+		UUID:    "1",
+		Acked:   make(chan struct{}),
+		Nacked:  make(chan struct{}),
+		Timeout: make(chan time.Time),
+		Cancel:  func() { close(cancelled) },
+		Done:    func() { close(done) },
+		Ack:     func() error { t.Fatal("Ack should not be called when draining"); return nil },
+	}, stopped)
+
+	close(stopped)
+
+	waitClosed(t, cancelled, "Cancel was not called on drain")
+	waitClosed(t, done, "Done was not called on drain")
+}
+
+func waitClosed(t *testing.T, ch <-chan struct{}, failMsg string) {
+	t.Helper()
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal(failMsg)
+	}
+}
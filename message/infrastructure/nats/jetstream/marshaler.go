@@ -0,0 +1,84 @@
+package jetstream
+
+import (
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	// UUIDHeaderKey is the NATS message header key used to carry the Watermill message UUID.
+	UUIDHeaderKey = "_watermill_message_uuid"
+
+	// MetadataHeaderKey is the NATS message header key used to carry the Watermill
+	// message metadata, JSON-encoded as a single value.
+	//
+	// Metadata keys are not stored as individual header names: nats.Header is backed
+	// by textproto.MIMEHeader, which canonicalizes header names (the first letter and
+	// any letter following a '-' are upper-cased, all other letters lower-cased), so a
+	// metadata key such as "UserID" would come back as "Userid" on the subscribing side.
+	MetadataHeaderKey = "_watermill_metadata"
+)
+
+// Marshaler marshals Watermill messages into NATS messages that can be published
+// to JetStream.
+type Marshaler interface {
+	Marshal(topic string, msg *message.Message) (*nats.Msg, error)
+}
+
+// Unmarshaler unmarshals a NATS message received from JetStream into a Watermill message.
+type Unmarshaler interface {
+	Unmarshal(msg *nats.Msg) (*message.Message, error)
+}
+
+// MarshalerUnmarshaler is both a Marshaler and an Unmarshaler.
+type MarshalerUnmarshaler interface {
+	Marshaler
+	Unmarshaler
+}
+
+// NATSMarshaler is the default MarshalerUnmarshaler.
+//
+// It stores the Watermill message UUID and metadata as NATS message headers,
+// leaving the payload untouched as the NATS message data, so that messages
+// published through this package remain readable by any other NATS/JetStream
+// consumer.
+type NATSMarshaler struct{}
+
+func (NATSMarshaler) Marshal(topic string, msg *message.Message) (*nats.Msg, error) {
+	header := nats.Header{}
+	header.Set(UUIDHeaderKey, msg.UUID)
+
+	if len(msg.Metadata) > 0 {
+		metadata, err := json.Marshal(msg.Metadata)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot marshal metadata")
+		}
+
+		header.Set(MetadataHeaderKey, string(metadata))
+	}
+
+	return &nats.Msg{
+		Subject: topic,
+		Header:  header,
+		Data:    msg.Payload,
+	}, nil
+}
+
+func (NATSMarshaler) Unmarshal(natsMsg *nats.Msg) (*message.Message, error) {
+	metadata := message.Metadata{}
+
+	if raw := natsMsg.Header.Get(MetadataHeaderKey); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &metadata); err != nil {
+			return nil, errors.Wrap(err, "cannot unmarshal metadata")
+		}
+	}
+
+	msg := message.NewMessage(natsMsg.Header.Get(UUIDHeaderKey), natsMsg.Data)
+	msg.Metadata = metadata
+
+	return msg, nil
+}
@@ -0,0 +1,63 @@
+package jetstream
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+func TestNATSMarshaler_MarshalUnmarshal(t *testing.T) {
+	msg := message.NewMessage("1", []byte("payload"))
+	msg.Metadata.Set("UserID", "123")
+	msg.Metadata.Set("traceID", "abc")
+
+	marshaler := NATSMarshaler{}
+
+	natsMsg, err := marshaler.Marshal("topic", msg)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+
+	unmarshaled, err := marshaler.Unmarshal(natsMsg)
+	if err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+
+	if unmarshaled.UUID != msg.UUID {
+		t.Errorf("UUID = %q, want %q", unmarshaled.UUID, msg.UUID)
+	}
+
+	if string(unmarshaled.Payload) != string(msg.Payload) {
+		t.Errorf("Payload = %q, want %q", unmarshaled.Payload, msg.Payload)
+	}
+
+	// Metadata keys must survive the header round-trip case-sensitively: nats.Header
+	// is backed by textproto.MIMEHeader, which canonicalizes header names, so storing
+	// keys as header names rather than inside a single encoded value would silently
+	// turn "UserID"/"traceID" into "Userid"/"Traceid".
+	for key, value := range msg.Metadata {
+		if got := unmarshaled.Metadata.Get(key); got != value {
+			t.Errorf("Metadata[%q] = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestNATSMarshaler_Unmarshal_noMetadata(t *testing.T) {
+	marshaler := NATSMarshaler{}
+
+	msg := message.NewMessage("1", []byte("payload"))
+
+	natsMsg, err := marshaler.Marshal("topic", msg)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+
+	unmarshaled, err := marshaler.Unmarshal(natsMsg)
+	if err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+
+	if len(unmarshaled.Metadata) != 0 {
+		t.Errorf("Metadata = %v, want empty", unmarshaled.Metadata)
+	}
+}
@@ -0,0 +1,107 @@
+package jetstream
+
+import (
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// PublisherConfig configures a Publisher backed by NATS JetStream.
+type PublisherConfig struct {
+	// URL is the NATS server URL, for example "nats://localhost:4222".
+	URL string
+
+	// NatsOptions are custom []nats.Option passed to nats.Connect.
+	NatsOptions []nats.Option
+
+	// JetStreamOptions are custom []nats.JSOpt passed when obtaining the JetStreamContext.
+	JetStreamOptions []nats.JSOpt
+
+	// Marshaler is used to marshal messages from the Watermill format to the NATS format.
+	Marshaler Marshaler
+
+	// AutoProvision, when true, creates the stream if it does not already exist.
+	AutoProvision bool
+
+	// StreamConfig is used to create the stream when AutoProvision is true.
+	// StreamConfig.Name must be set.
+	StreamConfig nats.StreamConfig
+}
+
+func (c *PublisherConfig) setDefaults() {
+	if c.Marshaler == nil {
+		c.Marshaler = NATSMarshaler{}
+	}
+}
+
+func (c *PublisherConfig) Validate() error {
+	if c.URL == "" {
+		return errors.New("PublisherConfig.URL is missing")
+	}
+
+	return nil
+}
+
+// Publisher publishes messages to NATS JetStream.
+type Publisher struct {
+	conn   *nats.Conn
+	js     nats.JetStreamContext
+	config PublisherConfig
+}
+
+// NewPublisher creates a new Publisher.
+func NewPublisher(config PublisherConfig) (*Publisher, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	conn, err := nats.Connect(config.URL, config.NatsOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to NATS")
+	}
+
+	js, err := conn.JetStream(config.JetStreamOptions...)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "cannot obtain JetStream context")
+	}
+
+	if config.AutoProvision {
+		if _, err := js.AddStream(&config.StreamConfig); err != nil && err != nats.ErrStreamNameAlreadyInUse {
+			conn.Close()
+			return nil, errors.Wrap(err, "cannot create stream")
+		}
+	}
+
+	return &Publisher{
+		conn:   conn,
+		js:     js,
+		config: config,
+	}, nil
+}
+
+// Publish publishes the provided messages to the given topic (JetStream subject).
+// Publish blocks until an ack is received from the JetStream server for every message.
+func (p *Publisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		natsMsg, err := p.config.Marshaler.Marshal(topic, msg)
+		if err != nil {
+			return errors.Wrap(err, "cannot marshal message")
+		}
+
+		if _, err := p.js.PublishMsg(natsMsg); err != nil {
+			return errors.Wrap(err, "cannot publish message")
+		}
+	}
+
+	return nil
+}
+
+// Close closes the publisher and the underlying NATS connection.
+func (p *Publisher) Close() error {
+	p.conn.Close()
+	return nil
+}
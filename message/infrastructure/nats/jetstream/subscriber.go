@@ -0,0 +1,479 @@
+package jetstream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	internalSync "github.com/ThreeDotsLabs/watermill/internal/sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/nats/internal/acktracker"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// SubscriberConfig configures a Subscriber backed by NATS JetStream.
+//
+// SubscriberConfig mirrors StreamingSubscriberConfig as closely as JetStream's
+// model allows, so switching from NATS Streaming is mostly a matter of
+// swapping the package import.
+type SubscriberConfig struct {
+	// URL is the NATS server URL, for example "nats://localhost:4222".
+	URL string
+
+	// NatsOptions are custom []nats.Option passed to nats.Connect.
+	NatsOptions []nats.Option
+
+	// JetStreamOptions are custom []nats.JSOpt passed when obtaining the JetStreamContext.
+	JetStreamOptions []nats.JSOpt
+
+	// Unmarshaler is used to unmarshal messages from the NATS format to the Watermill format.
+	Unmarshaler Unmarshaler
+
+	// AutoProvision, when true, creates the stream if it does not already exist.
+	// The durable consumer of a durable subscription is created from ConsumerConfig
+	// on Subscribe whether or not AutoProvision is set.
+	AutoProvision bool
+
+	// StreamConfig is used to create the stream when AutoProvision is true.
+	// StreamConfig.Name must be set.
+	StreamConfig nats.StreamConfig
+
+	// ConsumerConfig is the base consumer configuration for every subscription.
+	// MaxDeliver, AckPolicy, DeliverPolicy and FilterSubject are typically set here,
+	// for example to replay history via nats.DeliverAllPolicy. AckWait is always
+	// overwritten with AckWaitTimeout. An AckPolicy of nats.AckNonePolicy, which is
+	// also its zero value, is replaced with nats.AckExplicitPolicy, so AckNone
+	// cannot be selected through ConsumerConfig. For durable
+	// subscriptions it is sent to the server via js.AddConsumer; for ephemeral ones
+	// it is translated into nats.SubOpt at Subscribe time, since there is no
+	// pre-created consumer to carry it.
+	ConsumerConfig nats.ConsumerConfig
+
+	// QueueGroup is the JetStream queue group. All subscriptions sharing a queue group
+	// (and a durable name, see DurableName) form a queue, and each message is delivered
+	// to only one subscriber in the group.
+	//
+	// It is recommended to set it together with DurableName.
+	QueueGroup string
+
+	// DurableName is the JetStream durable consumer name. Durable consumers survive
+	// client restarts and resume delivery from the last acknowledged message.
+	//
+	// When QueueGroup is set, all subscribers share this single durable consumer,
+	// which is how fan-out across SubscribersCount goroutines is achieved.
+	DurableName string
+
+	// PullConsumer, when true, uses a pull consumer (js.PullSubscribe) instead of a
+	// push consumer (js.Subscribe/js.QueueSubscribe). Pull consumers are recommended
+	// for most workloads, since they let the client control its own pace.
+	PullConsumer bool
+
+	// PullBatchSize is the number of messages fetched per Fetch call when PullConsumer is true.
+	PullBatchSize int
+
+	// PullMaxWaiting is the maximum time to wait for a batch to fill up when PullConsumer is true.
+	PullMaxWaiting time.Duration
+
+	// SubscribersCount determines how many concurrent subscribers should be started.
+	SubscribersCount int
+
+	// CloseTimeout determines how long Close waits for the subscriptions to shut down.
+	// Messages still waiting for Ack/Nack when closing starts are released without
+	// a broker-level ack.
+	CloseTimeout time.Duration
+
+	// AckWaitTimeout is how long the subscriber will wait for Ack/Nack before the
+	// message is considered timed out and will be redelivered by JetStream.
+	// It is mapped to ConsumerConfig.AckWait.
+	AckWaitTimeout time.Duration
+
+	// SubOpts are custom []nats.SubOpt passed to the subscription.
+	SubOpts []nats.SubOpt
+}
+
+func (c *SubscriberConfig) setDefaults() {
+	if c.SubscribersCount <= 0 {
+		c.SubscribersCount = 1
+	}
+	if c.CloseTimeout <= 0 {
+		c.CloseTimeout = time.Second * 30
+	}
+	if c.AckWaitTimeout <= 0 {
+		c.AckWaitTimeout = time.Second * 30
+	}
+	if c.PullBatchSize <= 0 {
+		c.PullBatchSize = 10
+	}
+	if c.PullMaxWaiting <= 0 {
+		c.PullMaxWaiting = time.Second * 5
+	}
+	if c.Unmarshaler == nil {
+		c.Unmarshaler = NATSMarshaler{}
+	}
+
+	c.ConsumerConfig.AckWait = c.AckWaitTimeout
+	if c.ConsumerConfig.AckPolicy == nats.AckNonePolicy {
+		c.ConsumerConfig.AckPolicy = nats.AckExplicitPolicy
+	}
+	if c.DurableName != "" {
+		c.ConsumerConfig.Durable = c.DurableName
+	}
+}
+
+func (c *SubscriberConfig) Validate() error {
+	if c.URL == "" {
+		return errors.New("SubscriberConfig.URL is missing")
+	}
+
+	if c.QueueGroup == "" && c.SubscribersCount > 1 {
+		return errors.New(
+			"to set SubscriberConfig.SubscribersCount " +
+				"you need to also set SubscriberConfig.QueueGroup, " +
+				"in other case you will receive duplicated messages",
+		)
+	}
+
+	if c.QueueGroup != "" && c.DurableName == "" {
+		return errors.New(
+			"SubscriberConfig.QueueGroup requires SubscriberConfig.DurableName " +
+				"to be set, so that all subscribers share the same durable consumer",
+		)
+	}
+
+	return nil
+}
+
+// Subscriber subscribes to messages from NATS JetStream.
+//
+// Subscriber is the supported successor to StreamingSubscriber: it speaks the
+// same Watermill semantics (manual ack, QueueGroup-style fan-out via a shared
+// durable) on top of JetStream rather than the deprecated NATS Streaming server.
+type Subscriber struct {
+	conn   *nats.Conn
+	js     nats.JetStreamContext
+	logger watermill.LoggerAdapter
+
+	config SubscriberConfig
+
+	subs     []*nats.Subscription
+	subsLock sync.Mutex
+
+	closed  bool
+	closing chan struct{}
+
+	outputsWg            sync.WaitGroup
+	processingMessagesWg sync.WaitGroup
+}
+
+// NewSubscriber creates a new Subscriber.
+func NewSubscriber(config SubscriberConfig, logger watermill.LoggerAdapter) (*Subscriber, error) {
+	config.setDefaults()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	conn, err := nats.Connect(config.URL, config.NatsOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to NATS")
+	}
+
+	js, err := conn.JetStream(config.JetStreamOptions...)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "cannot obtain JetStream context")
+	}
+
+	if config.AutoProvision {
+		if _, err := js.AddStream(&config.StreamConfig); err != nil && err != nats.ErrStreamNameAlreadyInUse {
+			conn.Close()
+			return nil, errors.Wrap(err, "cannot create stream")
+		}
+	}
+
+	return &Subscriber{
+		conn:    conn,
+		js:      js,
+		logger:  logger,
+		config:  config,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// Subscribe subscribes to messages from JetStream.
+//
+// Subscribe will spawn SubscribersCount goroutines. When QueueGroup and
+// DurableName are both set, all of them share the same durable consumer,
+// so messages are fanned out across the goroutines rather than duplicated.
+func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	output := make(chan *message.Message)
+	s.outputsWg.Add(1)
+
+	for i := 0; i < s.config.SubscribersCount; i++ {
+		subscriberLogFields := watermill.LogFields{
+			"subscriber_num": i,
+			"topic":          topic,
+		}
+
+		s.logger.Debug("Starting subscriber", subscriberLogFields)
+
+		tracker := acktracker.New(s.logger)
+		stopped := make(chan struct{})
+
+		sub, err := s.subscribe(ctx, output, topic, subscriberLogFields, tracker, stopped)
+		if err != nil {
+			close(stopped)
+			return nil, errors.Wrap(err, "cannot subscribe")
+		}
+
+		go tracker.Run(stopped)
+
+		go func(subscriber *nats.Subscription, subscriberLogFields watermill.LogFields, stopped chan struct{}) {
+			select {
+			case <-s.closing:
+				// unblock
+			case <-ctx.Done():
+				// unblock
+			}
+			close(stopped)
+
+			if err := subscriber.Unsubscribe(); err != nil {
+				s.logger.Error("Cannot unsubscribe", err, subscriberLogFields)
+			}
+
+			close(output)
+			s.outputsWg.Done()
+		}(sub, subscriberLogFields, stopped)
+
+		s.subsLock.Lock()
+		s.subs = append(s.subs, sub)
+		s.subsLock.Unlock()
+	}
+
+	return output, nil
+}
+
+func (s *Subscriber) subscribe(
+	ctx context.Context,
+	output chan *message.Message,
+	topic string,
+	subscriberLogFields watermill.LogFields,
+	tracker *acktracker.Tracker,
+	stopped <-chan struct{},
+) (*nats.Subscription, error) {
+	if s.config.DurableName != "" {
+		if err := s.ensureConsumer(topic); err != nil {
+			return nil, errors.Wrap(err, "cannot create consumer")
+		}
+	}
+
+	opts := append([]nats.SubOpt{nats.ManualAck()}, s.config.SubOpts...)
+	if s.config.DurableName == "" {
+		opts = append(opts, s.ephemeralOpts(topic)...)
+	}
+
+	if s.config.PullConsumer {
+		sub, err := s.js.PullSubscribe(topic, s.config.DurableName, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		go s.pullLoop(ctx, sub, output, subscriberLogFields, tracker, stopped)
+		return sub, nil
+	}
+
+	if s.config.DurableName != "" {
+		opts = append(opts, nats.Bind(s.config.StreamConfig.Name, s.config.DurableName))
+	}
+
+	handler := func(m *nats.Msg) {
+		s.processMessage(ctx, m, output, subscriberLogFields, tracker, stopped)
+	}
+
+	if s.config.QueueGroup != "" {
+		return s.js.QueueSubscribe(topic, s.config.QueueGroup, handler, opts...)
+	}
+
+	return s.js.Subscribe(topic, handler, opts...)
+}
+
+// ensureConsumer creates the durable consumer this subscription binds to, from
+// ConsumerConfig, so that the first Subscribe call against a fresh stream succeeds
+// instead of failing because no consumer exists yet to Bind to.
+func (s *Subscriber) ensureConsumer(topic string) error {
+	consumerConfig := s.config.ConsumerConfig
+	if consumerConfig.FilterSubject == "" {
+		consumerConfig.FilterSubject = topic
+	}
+
+	_, err := s.js.AddConsumer(s.config.StreamConfig.Name, &consumerConfig)
+	if err != nil && err != nats.ErrConsumerNameAlreadyInUse {
+		return err
+	}
+
+	return nil
+}
+
+// ephemeralOpts translates ConsumerConfig into nats.SubOpt for an ephemeral
+// (non-durable) consumer. Ephemeral consumers have no pre-created server-side
+// configuration to Bind to, so AckWait, MaxDeliver, AckPolicy, DeliverPolicy and
+// FilterSubject must be passed at Subscribe time instead.
+func (s *Subscriber) ephemeralOpts(topic string) []nats.SubOpt {
+	cfg := s.config.ConsumerConfig
+
+	opts := []nats.SubOpt{
+		nats.AckWait(cfg.AckWait),
+		ackPolicyOpt(cfg.AckPolicy),
+		deliverPolicyOpt(cfg),
+	}
+
+	if cfg.MaxDeliver > 0 {
+		opts = append(opts, nats.MaxDeliver(cfg.MaxDeliver))
+	}
+
+	filterSubject := cfg.FilterSubject
+	if filterSubject == "" {
+		filterSubject = topic
+	}
+
+	return append(opts, nats.FilterSubject(filterSubject))
+}
+
+func ackPolicyOpt(policy nats.AckPolicy) nats.SubOpt {
+	switch policy {
+	case nats.AckAllPolicy:
+		return nats.AckAll()
+	case nats.AckNonePolicy:
+		return nats.AckNone()
+	default:
+		return nats.AckExplicit()
+	}
+}
+
+func deliverPolicyOpt(cfg nats.ConsumerConfig) nats.SubOpt {
+	switch cfg.DeliverPolicy {
+	case nats.DeliverLastPolicy:
+		return nats.DeliverLast()
+	case nats.DeliverNewPolicy:
+		return nats.DeliverNew()
+	case nats.DeliverByStartSequencePolicy:
+		return nats.StartSequence(cfg.OptStartSeq)
+	case nats.DeliverByStartTimePolicy:
+		if cfg.OptStartTime != nil {
+			return nats.StartTime(*cfg.OptStartTime)
+		}
+		return nats.DeliverAll()
+	default:
+		return nats.DeliverAll()
+	}
+}
+
+func (s *Subscriber) pullLoop(
+	ctx context.Context,
+	sub *nats.Subscription,
+	output chan *message.Message,
+	logFields watermill.LogFields,
+	tracker *acktracker.Tracker,
+	stopped <-chan struct{},
+) {
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		msgs, err := sub.Fetch(s.config.PullBatchSize, nats.MaxWait(s.config.PullMaxWaiting))
+		if err != nil && err != nats.ErrTimeout {
+			s.logger.Error("Cannot fetch messages", err, logFields)
+			continue
+		}
+
+		// processMessage registers each message with tracker and returns without
+		// waiting for its ack, so the whole batch is handed off before the next Fetch,
+		// rather than one message at a time.
+		for _, m := range msgs {
+			s.processMessage(ctx, m, output, logFields, tracker, stopped)
+		}
+	}
+}
+
+func (s *Subscriber) processMessage(
+	ctx context.Context,
+	m *nats.Msg,
+	output chan *message.Message,
+	logFields watermill.LogFields,
+	tracker *acktracker.Tracker,
+	stopped <-chan struct{},
+) {
+	if s.closed {
+		return
+	}
+
+	s.processingMessagesWg.Add(1)
+	done := s.processingMessagesWg.Done
+
+	s.logger.Trace("Received message", logFields)
+
+	msg, err := s.config.Unmarshaler.Unmarshal(m)
+	if err != nil {
+		s.logger.Error("Cannot unmarshal message", err, logFields)
+		done()
+		return
+	}
+
+	ctx, cancelCtx := context.WithCancel(ctx)
+	msg.SetContext(ctx)
+
+	messageLogFields := logFields.Add(watermill.LogFields{"message_uuid": msg.UUID})
+	s.logger.Trace("Unmarshaled message", messageLogFields)
+
+	select {
+	case output <- msg:
+		s.logger.Trace("Message sent to consumer", messageLogFields)
+	case <-s.closing:
+		s.logger.Trace("Closing, message discarded", messageLogFields)
+		cancelCtx()
+		done()
+		return
+	}
+
+	tracker.Track(&acktracker.Pending{
+		UUID:      msg.UUID,
+		Acked:     msg.Acked(),
+		Nacked:    msg.Nacked(),
+		Timeout:   time.After(s.config.AckWaitTimeout),
+		LogFields: messageLogFields,
+		Cancel:    cancelCtx,
+		Done:      done,
+		Ack:       m.Ack,
+		Nack:      m.Nak,
+	}, stopped)
+}
+
+// Close closes the subscriber and the underlying NATS connection.
+func (s *Subscriber) Close() error {
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	s.logger.Debug("Closing subscriber", nil)
+	defer s.logger.Info("Subscriber closed", nil)
+
+	close(s.closing)
+	internalSync.WaitGroupTimeout(&s.outputsWg, s.config.CloseTimeout)
+
+	s.conn.Close()
+
+	return nil
+}
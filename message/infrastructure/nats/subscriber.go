@@ -2,6 +2,8 @@ package nats
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"sync"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/ThreeDotsLabs/watermill"
 
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/infrastructure/nats/internal/acktracker"
 	"github.com/nats-io/go-nats-streaming"
 	"github.com/pkg/errors"
 )
@@ -51,6 +54,48 @@ type StreamingSubscriberConfig struct {
 	// the last acknowledged message for that ClientID + DurableName.
 	DurableName string
 
+	// DurableCalculator, when non-nil, computes the durable name for a subscription from
+	// its topic and queue group instead of using the static DurableName.
+	//
+	// This avoids durable name collisions when multiple applications subscribe to
+	// overlapping topics through the same queue group: use DefaultDurableCalculator,
+	// or supply a custom one, to derive a per-topic durable name instead of sharing
+	// a single static one across every subscription.
+	DurableCalculator DurableCalculator
+
+	// StartAtSequence sets the subscription start position to a specific message sequence number.
+	//
+	// It is mapped to stan.StartAtSequence. StartAtSequence, StartAtTime, StartWithLastReceived
+	// and DeliverAllAvailable are mutually exclusive.
+	StartAtSequence uint64
+
+	// StartAtTime sets the subscription start position to messages published at or after this time.
+	//
+	// It is mapped to stan.StartAtTime. StartAtSequence, StartAtTime, StartWithLastReceived
+	// and DeliverAllAvailable are mutually exclusive.
+	StartAtTime time.Time
+
+	// StartAtTimeDelta sets the subscription start position to messages published at least this
+	// long ago, relative to now.
+	//
+	// It is mapped to stan.StartAtTimeDelta. StartAtTimeDelta, StartAtSequence, StartAtTime,
+	// StartWithLastReceived and DeliverAllAvailable are mutually exclusive.
+	StartAtTimeDelta time.Duration
+
+	// StartWithLastReceived sets the subscription start position to the last message received by
+	// any subscriber on this subject.
+	//
+	// It is mapped to stan.StartWithLastReceived. StartWithLastReceived, StartAtSequence, StartAtTime
+	// and DeliverAllAvailable are mutually exclusive.
+	StartWithLastReceived bool
+
+	// DeliverAllAvailable sets the subscription start position to the oldest message still
+	// available in the channel, effectively replaying the whole history.
+	//
+	// It is mapped to stan.DeliverAllAvailable. DeliverAllAvailable, StartAtSequence, StartAtTime
+	// and StartWithLastReceived are mutually exclusive.
+	DeliverAllAvailable bool
+
 	// SubscribersCount determines wow much concurrent subscribers should be started.
 	SubscribersCount int
 
@@ -62,6 +107,15 @@ type StreamingSubscriberConfig struct {
 	// It is mapped to stan.AckWait option.
 	AckWaitTimeout time.Duration
 
+	// MaxInflight is the maximum number of unacknowledged messages stan will deliver to a
+	// subscription at once. It is mapped to stan.MaxInflight.
+	//
+	// Tracking pending Ack/Nack for each of these messages happens out of band of stan's
+	// own delivery goroutine (see the acktracker package), so unlike a bare stan
+	// subscription, setting MaxInflight here actually raises the subscriber's
+	// throughput instead of just its redelivery buffer.
+	MaxInflight int
+
 	// StanOptions are custom []stan.Option passed to the connection.
 	// It is also used to provide connection parameters, for example:
 	// 		stan.NatsURL("nats://localhost:4222")
@@ -72,6 +126,22 @@ type StreamingSubscriberConfig struct {
 
 	// Unmarshaler is an unmarshaler used to unmarshaling messages from NATS format to Watermill format.
 	Unmarshaler Unmarshaler
+
+	// ConnectionLostHandler is called, in addition to the Subscriber's own reconnect logic,
+	// whenever the underlying stan.Conn is permanently lost. It is wired to stan.SetConnectionLostHandler.
+	//
+	// NATS Streaming does not restore stan state when the underlying NATS connection reconnects,
+	// so losing the stan connection requires reconnecting and resubscribing from scratch; the
+	// Subscriber does this automatically, but ConnectionLostHandler can be used for alerting.
+	ConnectionLostHandler stan.ConnectionLostHandler
+
+	// ReconnectInitialWait is how long the Subscriber waits after the first failed reconnect
+	// attempt before retrying, doubling on every further failed attempt up to ReconnectMaxWait.
+	// The first reconnect attempt is made as soon as the connection is lost.
+	ReconnectInitialWait time.Duration
+
+	// ReconnectMaxWait caps the exponential backoff between reconnect attempts.
+	ReconnectMaxWait time.Duration
 }
 
 func (c *StreamingSubscriberConfig) setDefaults() {
@@ -84,6 +154,12 @@ func (c *StreamingSubscriberConfig) setDefaults() {
 	if c.AckWaitTimeout <= 0 {
 		c.AckWaitTimeout = time.Second * 30
 	}
+	if c.ReconnectInitialWait <= 0 {
+		c.ReconnectInitialWait = time.Second
+	}
+	if c.ReconnectMaxWait <= 0 {
+		c.ReconnectMaxWait = time.Minute
+	}
 
 	c.StanSubscriptionOptions = append(
 		c.StanSubscriptionOptions,
@@ -94,6 +170,34 @@ func (c *StreamingSubscriberConfig) setDefaults() {
 	if c.DurableName != "" {
 		c.StanSubscriptionOptions = append(c.StanSubscriptionOptions, stan.DurableName(c.DurableName))
 	}
+
+	if c.MaxInflight > 0 {
+		c.StanSubscriptionOptions = append(c.StanSubscriptionOptions, stan.MaxInflight(c.MaxInflight))
+	}
+
+	if startAt := c.startAtOption(); startAt != nil {
+		c.StanSubscriptionOptions = append(c.StanSubscriptionOptions, startAt)
+	}
+}
+
+// startAtOption translates the first set start position field into the matching
+// stan.SubscriptionOption. When none are set, it returns nil and stan's own default
+// (new messages only) applies.
+func (c *StreamingSubscriberConfig) startAtOption() stan.SubscriptionOption {
+	switch {
+	case c.DeliverAllAvailable:
+		return stan.DeliverAllAvailable()
+	case c.StartWithLastReceived:
+		return stan.StartWithLastReceived()
+	case c.StartAtSequence != 0:
+		return stan.StartAtSequence(c.StartAtSequence)
+	case !c.StartAtTime.IsZero():
+		return stan.StartAtTime(c.StartAtTime)
+	case c.StartAtTimeDelta != 0:
+		return stan.StartAtTimeDelta(c.StartAtTimeDelta)
+	default:
+		return nil
+	}
 }
 
 func (c *StreamingSubscriberConfig) Validate() error {
@@ -109,16 +213,41 @@ func (c *StreamingSubscriberConfig) Validate() error {
 		)
 	}
 
+	startPositionsSet := 0
+	if c.DeliverAllAvailable {
+		startPositionsSet++
+	}
+	if c.StartWithLastReceived {
+		startPositionsSet++
+	}
+	if c.StartAtSequence != 0 {
+		startPositionsSet++
+	}
+	if !c.StartAtTime.IsZero() {
+		startPositionsSet++
+	}
+	if c.StartAtTimeDelta != 0 {
+		startPositionsSet++
+	}
+	if startPositionsSet > 1 {
+		return errors.New(
+			"StreamingSubscriberConfig.StartAtSequence, StartAtTime, StartAtTimeDelta, " +
+				"StartWithLastReceived and DeliverAllAvailable are mutually exclusive",
+		)
+	}
+
 	return nil
 }
 
 type StreamingSubscriber struct {
-	conn   stan.Conn
+	conn     stan.Conn
+	connLock sync.RWMutex
+
 	logger watermill.LoggerAdapter
 
 	config StreamingSubscriberConfig
 
-	subs     []stan.Subscription
+	subs     []*activeSubscription
 	subsLock sync.Mutex
 
 	closed  bool
@@ -128,6 +257,23 @@ type StreamingSubscriber struct {
 	processingMessagesWg sync.WaitGroup
 }
 
+// activeSubscription tracks everything needed to resubscribe to a topic after the
+// stan connection is lost and rebuilt.
+type activeSubscription struct {
+	ctx          context.Context
+	topic        string
+	output       chan *message.Message
+	logFields    watermill.LogFields
+	extraOptions []stan.SubscriptionOption
+
+	// tracker and stopped track in-flight Ack/Nack for this subscription across reconnects;
+	// both are created once and reused by resubscribeAll.
+	tracker *acktracker.Tracker
+	stopped chan struct{}
+
+	sub stan.Subscription
+}
+
 // NewStreamingSubscriber creates a new StreamingSubscriber.
 //
 // When using custom NATS hostname, you should pass it by options StreamingSubscriberConfig.StanOptions:
@@ -143,23 +289,217 @@ func NewStreamingSubscriber(config StreamingSubscriberConfig, logger watermill.L
 		return nil, err
 	}
 
-	conn, err := stan.Connect(config.ClusterID, config.ClientID, config.StanOptions...)
+	s := &StreamingSubscriber{
+		logger:  logger,
+		config:  config,
+		closing: make(chan struct{}),
+	}
+
+	conn, err := stan.Connect(config.ClusterID, config.ClientID, s.stanOptions()...)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot connect to NATS")
 	}
+	s.conn = conn
 
-	return &StreamingSubscriber{
-		conn:    conn,
-		logger:  logger,
-		config:  config,
-		closing: make(chan struct{}),
-	}, nil
+	return s, nil
+}
+
+// stanOptions returns config.StanOptions with the internal connection-lost handler appended,
+// so every (re)connect keeps the reconnect loop wired up.
+func (s *StreamingSubscriber) stanOptions() []stan.Option {
+	return append(append([]stan.Option{}, s.config.StanOptions...), stan.SetConnectionLostHandler(s.handleConnectionLost))
+}
+
+// handleConnectionLost is called by stan when the connection is permanently lost. It notifies
+// the configured ConnectionLostHandler, if any, and starts reconnecting in the background.
+func (s *StreamingSubscriber) handleConnectionLost(conn stan.Conn, reason error) {
+	if s.config.ConnectionLostHandler != nil {
+		s.config.ConnectionLostHandler(conn, reason)
+	}
+
+	select {
+	case <-s.closing:
+		return
+	default:
+	}
+
+	s.logger.Error("Lost connection to NATS Streaming, reconnecting", reason, nil)
+	go s.reconnect()
+}
+
+// reconnect rebuilds the stan connection and resubscribes every active subscription,
+// retrying with an exponential backoff until it succeeds or the subscriber is closed.
+func (s *StreamingSubscriber) reconnect() {
+	wait := s.config.ReconnectInitialWait
+
+	for {
+		select {
+		case <-s.closing:
+			return
+		default:
+		}
+
+		conn, err := stan.Connect(s.config.ClusterID, s.config.ClientID, s.stanOptions()...)
+		if err != nil {
+			s.logger.Error(
+				"Cannot reconnect to NATS Streaming, will retry",
+				err,
+				watermill.LogFields{"wait": wait.String()},
+			)
+
+			if !s.waitBackoff(&wait) {
+				return
+			}
+			continue
+		}
+
+		s.connLock.Lock()
+		s.conn = conn
+		s.connLock.Unlock()
+
+		if err := s.resubscribeAll(); err != nil {
+			s.logger.Error("Cannot resubscribe after reconnect, will retry", err, nil)
+
+			if closeErr := conn.Close(); closeErr != nil {
+				s.logger.Error("Cannot close conn after failed resubscribe", closeErr, nil)
+			}
+
+			if !s.waitBackoff(&wait) {
+				return
+			}
+			continue
+		}
+
+		s.logger.Info("Reconnected to NATS Streaming", nil)
+		return
+	}
+}
+
+// waitBackoff sleeps for *wait, doubling it (capped at ReconnectMaxWait) for the next
+// call, and reports whether the subscriber is still open.
+func (s *StreamingSubscriber) waitBackoff(wait *time.Duration) bool {
+	select {
+	case <-time.After(*wait):
+	case <-s.closing:
+		return false
+	}
+
+	if *wait *= 2; *wait > s.config.ReconnectMaxWait {
+		*wait = s.config.ReconnectMaxWait
+	}
+
+	return true
+}
+
+// resubscribeAll recreates every tracked subscription on the current connection.
+func (s *StreamingSubscriber) resubscribeAll() error {
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	for _, active := range s.subs {
+		sub, err := s.subscribe(active.ctx, active.output, active.topic, active.logFields, active.tracker, active.stopped, active.extraOptions...)
+		if err != nil {
+			return errors.Wrapf(err, "cannot resubscribe to %s", active.topic)
+		}
+		active.sub = sub
+	}
+
+	return nil
+}
+
+// getConn returns the current stan connection, safe to call while a reconnect is in progress.
+func (s *StreamingSubscriber) getConn() stan.Conn {
+	s.connLock.RLock()
+	defer s.connLock.RUnlock()
+	return s.conn
 }
 
 // Subscribe subscribes messages from NATS Streaming.
 //
 // Subscribe will spawn SubscribersCount goroutines making subscribe.
 func (s *StreamingSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	return s.doSubscribe(ctx, topic)
+}
+
+func (s *StreamingSubscriber) SubscribeInitialize(topic string) (err error) {
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	tracker := acktracker.New(s.logger)
+	go tracker.Run(stopped)
+
+	sub, err := s.subscribe(context.Background(), make(chan *message.Message), topic, nil, tracker, stopped)
+	if err != nil {
+		return errors.Wrap(err, "cannot initialize subscribe")
+	}
+
+	return errors.Wrap(sub.Close(), "cannot close after subscribe initialize")
+}
+
+// DurableCalculator computes the durable name to use for a subscription on topic,
+// within queueGroup (empty when no queue group is used).
+type DurableCalculator func(topic, queueGroup string) string
+
+// DefaultDurableCalculator returns a DurableCalculator that concatenates prefix with
+// a hex-encoded hash of the topic. Instances of the same app (sharing prefix) therefore
+// converge onto the same durable name for a given topic, while different apps or
+// different topics get different durables and don't clash.
+func DefaultDurableCalculator(prefix string) DurableCalculator {
+	return func(topic, queueGroup string) string {
+		hash := sha256.Sum256([]byte(topic))
+		return prefix + hex.EncodeToString(hash[:])
+	}
+}
+
+// StartPosition requests that a subscription start delivering messages from a given
+// point in the channel's history, overriding StreamingSubscriberConfig's own start
+// position fields for that one call. Build one with StartAtSequence, StartAtTime,
+// StartAtTimeDelta, StartWithLastReceived or DeliverAllAvailable.
+type StartPosition struct {
+	option stan.SubscriptionOption
+}
+
+// StartAtSequence starts the subscription at a specific message sequence number.
+func StartAtSequence(sequence uint64) StartPosition {
+	return StartPosition{option: stan.StartAtSequence(sequence)}
+}
+
+// StartAtTime starts the subscription at messages published at or after the given time.
+func StartAtTime(t time.Time) StartPosition {
+	return StartPosition{option: stan.StartAtTime(t)}
+}
+
+// StartAtTimeDelta starts the subscription at messages published at least delta ago.
+func StartAtTimeDelta(delta time.Duration) StartPosition {
+	return StartPosition{option: stan.StartAtTimeDelta(delta)}
+}
+
+// StartWithLastReceived starts the subscription at the last message received by any
+// subscriber on this subject.
+func StartWithLastReceived() StartPosition {
+	return StartPosition{option: stan.StartWithLastReceived()}
+}
+
+// DeliverAllAvailable starts the subscription at the oldest message still available
+// in the channel, replaying the whole history.
+func DeliverAllAvailable() StartPosition {
+	return StartPosition{option: stan.DeliverAllAvailable()}
+}
+
+// SubscribeFrom subscribes to messages from NATS Streaming the same way Subscribe does,
+// but requests a specific start position for this call only, without changing the
+// StreamingSubscriberConfig the Subscriber was built with.
+//
+// This is useful to reprocess a topic from a known sequence, for example after a bug fix,
+// without having to build a new Subscriber.
+func (s *StreamingSubscriber) SubscribeFrom(ctx context.Context, topic string, start StartPosition) (<-chan *message.Message, error) {
+	return s.doSubscribe(ctx, topic, start.option)
+}
+
+// doSubscribe implements Subscribe and SubscribeFrom: it spawns SubscribersCount
+// goroutines subscribing to topic, optionally overriding the subscription start
+// position via extraOptions.
+func (s *StreamingSubscriber) doSubscribe(ctx context.Context, topic string, extraOptions ...stan.SubscriptionOption) (<-chan *message.Message, error) {
 	output := make(chan *message.Message, 0)
 	s.outputsWg.Add(1)
 
@@ -171,41 +511,71 @@ func (s *StreamingSubscriber) Subscribe(ctx context.Context, topic string) (<-ch
 
 		s.logger.Debug("Starting subscriber", subscriberLogFields)
 
-		sub, err := s.subscribe(ctx, output, topic, subscriberLogFields)
+		tracker := acktracker.New(s.logger)
+		stopped := make(chan struct{})
+
+		sub, err := s.subscribe(ctx, output, topic, subscriberLogFields, tracker, stopped, extraOptions...)
 		if err != nil {
+			close(stopped)
 			return nil, errors.Wrap(err, "cannot subscribe")
 		}
 
-		go func(subscriber stan.Subscription, subscriberLogFields watermill.LogFields) {
+		go tracker.Run(stopped)
+
+		active := &activeSubscription{
+			ctx:          ctx,
+			topic:        topic,
+			output:       output,
+			logFields:    subscriberLogFields,
+			extraOptions: extraOptions,
+			tracker:      tracker,
+			stopped:      stopped,
+			sub:          sub,
+		}
+
+		go func(active *activeSubscription) {
 			select {
 			case <-s.closing:
 				// unblock
 			case <-ctx.Done():
 				// unblock
 			}
-			if err := sub.Close(); err != nil {
-				s.logger.Error("Cannot close subscriber", err, subscriberLogFields)
+			close(active.stopped)
+
+			s.subsLock.Lock()
+			sub := active.sub
+			s.subsLock.Unlock()
+
+			if err := s.unsubscribe(sub); err != nil {
+				s.logger.Error("Cannot close subscriber", err, active.logFields)
 			}
 
 			close(output)
 			s.outputsWg.Done()
-		}(sub, subscriberLogFields)
+		}(active)
 
 		s.subsLock.Lock()
-		s.subs = append(s.subs, sub)
+		s.subs = append(s.subs, active)
 		s.subsLock.Unlock()
 	}
 
 	return output, nil
 }
 
-func (s *StreamingSubscriber) SubscribeInitialize(topic string) (err error) {
-	sub, err := s.subscribe(context.Background(), make(chan *message.Message), topic, nil)
-	if err != nil {
-		return errors.Wrap(err, "cannot initialize subscribe")
-	}
+// isDurable reports whether subscriptions made by this Subscriber use a durable name,
+// either static or computed via DurableCalculator.
+func (s *StreamingSubscriber) isDurable() bool {
+	return s.config.DurableName != "" || s.config.DurableCalculator != nil
+}
 
-	return errors.Wrap(sub.Close(), "cannot close after subscribe initialize")
+// unsubscribe drains sub the way its durability requires: a durable subscription is
+// only Close()d, so its state survives on the server for the next restart; a
+// non-durable one is Unsubscribe()d, so its state is cleaned up immediately.
+func (s *StreamingSubscriber) unsubscribe(sub stan.Subscription) error {
+	if s.isDurable() {
+		return sub.Close()
+	}
+	return sub.Unsubscribe()
 }
 
 func (s *StreamingSubscriber) subscribe(
@@ -213,51 +583,60 @@ func (s *StreamingSubscriber) subscribe(
 	output chan *message.Message,
 	topic string,
 	subscriberLogFields watermill.LogFields,
+	tracker *acktracker.Tracker,
+	stopped <-chan struct{},
+	extraOptions ...stan.SubscriptionOption,
 ) (stan.Subscription, error) {
+	options := append(append([]stan.SubscriptionOption{}, s.config.StanSubscriptionOptions...), extraOptions...)
+
+	if s.config.DurableCalculator != nil {
+		durableName := s.config.DurableCalculator(topic, s.config.QueueGroup)
+		options = append(options, stan.DurableName(durableName))
+	}
+
+	conn := s.getConn()
+
+	handler := func(m *stan.Msg) {
+		s.processMessage(ctx, m, output, subscriberLogFields, tracker, stopped)
+	}
+
 	if s.config.QueueGroup != "" {
-		return s.conn.QueueSubscribe(
-			topic,
-			s.config.QueueGroup,
-			func(m *stan.Msg) {
-				s.processMessage(ctx, m, output, subscriberLogFields)
-			},
-			s.config.StanSubscriptionOptions...,
-		)
+		return conn.QueueSubscribe(topic, s.config.QueueGroup, handler, options...)
 	}
 
-	return s.conn.Subscribe(
-		topic,
-		func(m *stan.Msg) {
-			s.processMessage(ctx, m, output, subscriberLogFields)
-		},
-		s.config.StanSubscriptionOptions...,
-	)
+	return conn.Subscribe(topic, handler, options...)
 }
 
+// processMessage unmarshals m, hands it to output and registers it with tracker for
+// Ack/Nack/timeout bookkeeping, then returns without waiting for that outcome. This
+// lets stan keep delivering further messages to the subscription (up to
+// StreamingSubscriberConfig.MaxInflight) instead of being limited to one in-flight
+// message per subscriber goroutine.
 func (s *StreamingSubscriber) processMessage(
 	ctx context.Context,
 	m *stan.Msg,
 	output chan *message.Message,
 	logFields watermill.LogFields,
+	tracker *acktracker.Tracker,
+	stopped <-chan struct{},
 ) {
 	if s.closed {
 		return
 	}
 
 	s.processingMessagesWg.Add(1)
-	defer s.processingMessagesWg.Done()
 
 	s.logger.Trace("Received message", logFields)
 
 	msg, err := s.config.Unmarshaler.Unmarshal(m)
 	if err != nil {
 		s.logger.Error("Cannot unmarshal message", err, logFields)
+		s.processingMessagesWg.Done()
 		return
 	}
 
 	ctx, cancelCtx := context.WithCancel(ctx)
 	msg.SetContext(ctx)
-	defer cancelCtx()
 
 	messageLogFields := logFields.Add(watermill.LogFields{"message_uuid": msg.UUID})
 	s.logger.Trace("Unmarshaled message", messageLogFields)
@@ -267,47 +646,59 @@ func (s *StreamingSubscriber) processMessage(
 		s.logger.Trace("Message sent to consumer", messageLogFields)
 	case <-s.closing:
 		s.logger.Trace("Closing, message discarded", messageLogFields)
+		cancelCtx()
+		s.processingMessagesWg.Done()
 		return
 	}
 
-	select {
-	case <-msg.Acked():
-		if err := m.Ack(); err != nil {
-			s.logger.Error("Cannot send ack", err, messageLogFields)
-		}
-		s.logger.Trace("Message Acked", messageLogFields)
-	case <-msg.Nacked():
-		s.logger.Trace("Message Nacked", messageLogFields)
-		return
-	case <-time.After(s.config.AckWaitTimeout):
-		s.logger.Trace("Ack timeouted", messageLogFields)
-		return
-	case <-s.closing:
-		s.logger.Trace("Closing, message discarded before ack", messageLogFields)
-		return
+	tracker.Track(&acktracker.Pending{
+		UUID:      msg.UUID,
+		Acked:     msg.Acked(),
+		Nacked:    msg.Nacked(),
+		Timeout:   time.After(s.config.AckWaitTimeout),
+		LogFields: messageLogFields,
+		Cancel:    cancelCtx,
+		Done:      s.processingMessagesWg.Done,
+		Ack:       m.Ack,
+		// stan has no nack of its own; Nack is left nil and only the
+		// Watermill-level Nacked() channel is observed.
+	}, stopped)
+}
+
+// Healthy reports whether the Subscriber is currently connected to NATS Streaming.
+// It is suitable for use as a Kubernetes readiness probe.
+func (s *StreamingSubscriber) Healthy() error {
+	conn := s.getConn()
+	if conn == nil {
+		return errors.New("not connected to NATS Streaming")
 	}
+
+	nc := conn.NatsConn()
+	if nc == nil || !nc.IsConnected() {
+		return errors.New("not connected to NATS Streaming")
+	}
+
+	return errors.Wrap(nc.FlushTimeout(5*time.Second), "cannot ping NATS")
 }
 
 func (s *StreamingSubscriber) Close() error {
 	s.subsLock.Lock()
-	defer s.subsLock.Unlock()
-
 	if s.closed {
+		s.subsLock.Unlock()
 		return nil
 	}
 	s.closed = true
+	s.subsLock.Unlock()
 
 	s.logger.Debug("Closing subscriber", nil)
 	defer s.logger.Info("StreamingSubscriber closed", nil)
 
-	var result error
-
 	close(s.closing)
 	internalSync.WaitGroupTimeout(&s.outputsWg, s.config.CloseTimeout)
 
-	if err := s.conn.Close(); err != nil {
+	if err := s.getConn().Close(); err != nil {
 		return errors.Wrap(err, "cannot close conn")
 	}
 
-	return result
+	return nil
 }
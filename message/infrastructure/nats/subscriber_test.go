@@ -0,0 +1,114 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nats-io/go-nats-streaming"
+)
+
+type stubUnmarshaler struct{}
+
+func (stubUnmarshaler) Unmarshal(m *stan.Msg) (*message.Message, error) {
+	return message.NewMessage("", nil), nil
+}
+
+func validStreamingSubscriberConfig() StreamingSubscriberConfig {
+	return StreamingSubscriberConfig{
+		ClusterID:   "cluster",
+		ClientID:    "client",
+		Unmarshaler: stubUnmarshaler{},
+	}
+}
+
+func TestStreamingSubscriberConfig_Validate_missingUnmarshaler(t *testing.T) {
+	config := validStreamingSubscriberConfig()
+	config.Unmarshaler = nil
+
+	if err := config.Validate(); err == nil {
+		t.Error("expected an error when Unmarshaler is missing")
+	}
+}
+
+func TestStreamingSubscriberConfig_Validate_subscribersCountRequiresQueueGroup(t *testing.T) {
+	config := validStreamingSubscriberConfig()
+	config.SubscribersCount = 2
+
+	if err := config.Validate(); err == nil {
+		t.Error("expected an error when SubscribersCount > 1 without QueueGroup")
+	}
+
+	config.QueueGroup = "group"
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error once QueueGroup is set: %v", err)
+	}
+}
+
+func TestStreamingSubscriberConfig_Validate_startPositionsAreMutuallyExclusive(t *testing.T) {
+	cases := map[string]StreamingSubscriberConfig{
+		"deliverAll + lastReceived": {DeliverAllAvailable: true, StartWithLastReceived: true},
+		"deliverAll + sequence":     {DeliverAllAvailable: true, StartAtSequence: 1},
+		"sequence + time":           {StartAtSequence: 1, StartAtTime: time.Now()},
+		"time + timeDelta":          {StartAtTime: time.Now(), StartAtTimeDelta: time.Minute},
+	}
+
+	for name, extra := range cases {
+		t.Run(name, func(t *testing.T) {
+			config := validStreamingSubscriberConfig()
+			config.DeliverAllAvailable = extra.DeliverAllAvailable
+			config.StartWithLastReceived = extra.StartWithLastReceived
+			config.StartAtSequence = extra.StartAtSequence
+			config.StartAtTime = extra.StartAtTime
+			config.StartAtTimeDelta = extra.StartAtTimeDelta
+
+			if err := config.Validate(); err == nil {
+				t.Error("expected an error for mutually exclusive start positions")
+			}
+		})
+	}
+}
+
+func TestStreamingSubscriberConfig_startAtOption(t *testing.T) {
+	cases := map[string]struct {
+		config  StreamingSubscriberConfig
+		wantNil bool
+	}{
+		"none set":              {StreamingSubscriberConfig{}, true},
+		"deliverAllAvailable":   {StreamingSubscriberConfig{DeliverAllAvailable: true}, false},
+		"startWithLastReceived": {StreamingSubscriberConfig{StartWithLastReceived: true}, false},
+		"startAtSequence":       {StreamingSubscriberConfig{StartAtSequence: 42}, false},
+		"startAtTime":           {StreamingSubscriberConfig{StartAtTime: time.Now()}, false},
+		"startAtTimeDelta":      {StreamingSubscriberConfig{StartAtTimeDelta: time.Hour}, false},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := c.config.startAtOption()
+			if c.wantNil && got != nil {
+				t.Errorf("startAtOption() = %v, want nil", got)
+			}
+			if !c.wantNil && got == nil {
+				t.Error("startAtOption() = nil, want a stan.SubscriptionOption")
+			}
+		})
+	}
+}
+
+func TestDefaultDurableCalculator(t *testing.T) {
+	calculator := DefaultDurableCalculator("myapp-")
+
+	first := calculator("orders.created", "")
+	second := calculator("orders.created", "")
+	other := calculator("orders.updated", "")
+
+	if first != second {
+		t.Errorf("DefaultDurableCalculator is not deterministic for the same topic: %q != %q", first, second)
+	}
+	if first == other {
+		t.Error("DefaultDurableCalculator returned the same durable name for different topics")
+	}
+	if len(first) <= len("myapp-") {
+		t.Errorf("expected durable name to be longer than just the prefix, got %q", first)
+	}
+}